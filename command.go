@@ -2,18 +2,37 @@ package vagrantutil
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/koding/logging"
 )
 
+// defaultGracePeriod is how long a command is given to exit after being
+// sent SIGINT before it's sent SIGKILL.
+const defaultGracePeriod = 10 * time.Second
+
 type command struct {
 	log logging.Logger
 	cwd string
 
+	// gracePeriod is how long to wait after sending SIGINT to a cancelled
+	// command before escalating to SIGKILL. Zero means defaultGracePeriod.
+	gracePeriod time.Duration
+
+	// binary is the executable to run. Empty means "vagrant" resolved
+	// from PATH.
+	binary string
+
+	// env is merged on top of os.Environ() for the spawned process.
+	env map[string]string
+
 	onSuccess func()
 	onFailure func(err error)
 
@@ -32,15 +51,43 @@ func newCommand(cwd string, log logging.Logger) *command {
 	return cmd
 }
 
-func (cmd *command) init(args []string) {
-	cmd.cmd = exec.Command("vagrant", args...)
+func (cmd *command) init(ctx context.Context, args []string) {
+	binary := cmd.binary
+	if binary == "" {
+		binary = "vagrant"
+	}
+
+	cmd.cmd = exec.CommandContext(ctx, binary, args...)
 	cmd.cmd.Dir = cmd.cwd
 
+	if len(cmd.env) > 0 {
+		env := os.Environ()
+		for k, v := range cmd.env {
+			env = append(env, k+"="+v)
+		}
+		cmd.cmd.Env = env
+	}
+
+	cmd.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	// On ctx.Done() send SIGINT to the process group first, so provisioners
+	// get a chance to clean up, and only escalate to SIGKILL (the default
+	// exec.CommandContext behavior) after gracePeriod.
+	cmd.cmd.Cancel = func() error {
+		return signalGroup(cmd.cmd, syscall.SIGINT)
+	}
+
+	grace := cmd.gracePeriod
+	if grace <= 0 {
+		grace = defaultGracePeriod
+	}
+	cmd.cmd.WaitDelay = grace
+
 	cmd.debugf("%s: executing: %v", cmd.cwd, cmd.cmd.Args)
 }
 
-func (cmd *command) run(args ...string) (string, error) {
-	cmd.init(args)
+func (cmd *command) run(ctx context.Context, args ...string) (string, error) {
+	cmd.init(ctx, args)
 
 	out, err := cmd.cmd.CombinedOutput()
 	if err != nil {
@@ -48,7 +95,7 @@ func (cmd *command) run(args ...string) (string, error) {
 			err = fmt.Errorf("%s: %s", err, out)
 		}
 
-		return "", cmd.done(err)
+		return "", cmd.done(cmd.canceledErr(ctx, err))
 	}
 
 	s := string(out)
@@ -61,9 +108,12 @@ func (cmd *command) run(args ...string) (string, error) {
 
 // start starts the command and sends back both the stdout and stderr to
 // the returned channel. Any error happened during the streaming is passed to
-// the Error field.
-func (cmd *command) start(args ...string) (ch <-chan *CommandOutput, err error) {
-	cmd.init(args)
+// the Error field. If ctx is cancelled or its deadline is exceeded before
+// the command exits, the command is sent SIGINT and, if it hasn't exited
+// within the grace period, SIGKILL; the resulting error is surfaced as
+// ctx.Err() rather than the raw signal-termination error.
+func (cmd *command) start(ctx context.Context, args ...string) (ch <-chan *CommandOutput, err error) {
+	cmd.init(ctx, args)
 
 	stdoutPipe, err := cmd.cmd.StdoutPipe()
 	if err != nil {
@@ -83,7 +133,7 @@ func (cmd *command) start(args ...string) (ch <-chan *CommandOutput, err error)
 	out := make(chan *CommandOutput)
 
 	output := func(r io.Reader) {
-		wg.Add(1)
+		defer wg.Done()
 		scanner := bufio.NewScanner(r)
 		for scanner.Scan() {
 			cmd.debugf("%s", scanner.Text())
@@ -94,16 +144,16 @@ func (cmd *command) start(args ...string) (ch <-chan *CommandOutput, err error)
 		if err := scanner.Err(); err != nil {
 			out <- &CommandOutput{Error: err}
 		}
-		wg.Done()
 	}
 
+	wg.Add(2)
 	go output(stdoutPipe)
 	go output(stderrPipe)
 
 	go func() {
 		wg.Wait()
-		var err error
-		if err = cmd.cmd.Wait(); err != nil {
+		err := cmd.canceledErr(ctx, cmd.cmd.Wait())
+		if err != nil {
 			out <- &CommandOutput{Error: err}
 		}
 
@@ -114,6 +164,31 @@ func (cmd *command) start(args ...string) (ch <-chan *CommandOutput, err error)
 	return out, nil
 }
 
+// canceledErr replaces err with ctx.Err() when the command was terminated
+// because ctx was cancelled or its deadline was exceeded, so callers see
+// context.Canceled/context.DeadlineExceeded instead of a raw signal-kill
+// *exec.ExitError.
+func (cmd *command) canceledErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// signalGroup delivers sig to c's process group, falling back to the
+// process itself if the group can't be resolved.
+func signalGroup(c *exec.Cmd, sig syscall.Signal) error {
+	if c.Process == nil {
+		return nil
+	}
+
+	if pgid, err := syscall.Getpgid(c.Process.Pid); err == nil {
+		return syscall.Kill(-pgid, sig)
+	}
+
+	return c.Process.Signal(sig)
+}
+
 func (cmd *command) done(err error) error {
 	if err == nil {
 		if cmd.onSuccess != nil {
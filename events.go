@@ -0,0 +1,196 @@
+package vagrantutil
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Event is a single machine-readable record emitted by vagrant, decoded
+// into one of the typed Event values below depending on its type.
+type Event interface {
+	// Meta returns the fields common to every event.
+	Meta() EventMeta
+}
+
+// EventMeta holds the fields every machine-readable record carries: when
+// it was emitted and which machine it targets (empty for environment-wide
+// events).
+type EventMeta struct {
+	Timestamp string
+	Target    string
+}
+
+// Meta implements Event.
+func (m EventMeta) Meta() EventMeta { return m }
+
+// ProgressEvent reports progress on a long-running operation, such as a
+// box download.
+type ProgressEvent struct {
+	EventMeta
+	Rate    string
+	Current int64
+	Total   int64
+}
+
+// UIEvent carries a line of human-readable output, the same text vagrant
+// itself would print to the terminal, tagged with its level (e.g. "info",
+// "warn", "error", "detail").
+type UIEvent struct {
+	EventMeta
+	Level   string
+	Message string
+}
+
+// StateEvent reports a machine's state, as also returned by Status.
+type StateEvent struct {
+	EventMeta
+	State Status
+}
+
+// BoxEvent reports the box in use for a machine.
+type BoxEvent struct {
+	EventMeta
+	Name string
+}
+
+// ErrorEvent reports an error raised by vagrant itself, or by the
+// underlying command's execution.
+type ErrorEvent struct {
+	EventMeta
+	Message string
+}
+
+// Events runs "vagrant <cmd> <args...>" with machine-readable output
+// enabled and streams it, decoded line-by-line into typed Events, on the
+// returned channel. Unlike the flat CommandOutput lines returned by Up and
+// friends, this lets callers render download progress bars and distinguish
+// stderr provisioner noise from real errors. Records of a type this
+// package doesn't model are silently skipped; see command.start for ctx's
+// cancellation semantics.
+func (v *Vagrant) Events(ctx context.Context, cmd string, args ...string) (<-chan Event, error) {
+	// --provider is only valid on "vagrant up"; other subcommands reject it.
+	if cmd == "up" {
+		args = v.withProvider(args)
+	}
+
+	lines, err := v.startCommand(ctx, append([]string{cmd}, append(args, "--machine-readable")...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+
+	go func() {
+		defer close(events)
+
+		for out := range lines {
+			if out.Error != nil {
+				events <- ErrorEvent{Message: out.Error.Error()}
+				continue
+			}
+
+			event, err := parseEvent(out.Line)
+			if err != nil || event == nil {
+				continue
+			}
+
+			events <- event
+		}
+	}()
+
+	return events, nil
+}
+
+// UpEventsContext is like UpContext, but decodes the machine-readable
+// output into typed Events instead of raw CommandOutput lines.
+func (v *Vagrant) UpEventsContext(ctx context.Context, vagrantfile string, machine ...string) (<-chan Event, error) {
+	if vagrantfile == "" {
+		return nil, errors.New("Vagrantfile content is empty")
+	}
+
+	m, err := machineArgs(machine)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := v.Create(vagrantfile); err != nil {
+		return nil, err
+	}
+
+	return v.Events(ctx, "up", m...)
+}
+
+// DestroyEventsContext is like DestroyContext, but decodes the
+// machine-readable output into typed Events instead of raw CommandOutput
+// lines.
+func (v *Vagrant) DestroyEventsContext(ctx context.Context, machine ...string) (<-chan Event, error) {
+	if err := v.vagrantfileExists(); err != nil {
+		return nil, err
+	}
+
+	m, err := machineArgs(machine)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.Events(ctx, "destroy", append(m, "--force")...)
+}
+
+// parseEvent decodes a single machine-readable CSV line into an Event. It
+// returns a nil Event, with a nil error, for record types this package
+// doesn't model.
+func parseEvent(line string) (Event, error) {
+	r := csv.NewReader(strings.NewReader(line))
+	record, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(record) < 3 {
+		return nil, nil
+	}
+
+	meta := EventMeta{Timestamp: record[0], Target: record[1]}
+	typeName := record[2]
+	data := record[3:]
+
+	switch typeName {
+	case "ui":
+		if len(data) < 2 {
+			return nil, nil
+		}
+		return UIEvent{EventMeta: meta, Level: data[0], Message: data[1]}, nil
+	case "state":
+		if len(data) < 1 {
+			return nil, nil
+		}
+		status, err := toStatus(data[0])
+		if err != nil {
+			return nil, nil
+		}
+		return StateEvent{EventMeta: meta, State: status}, nil
+	case "box-name":
+		if len(data) < 1 {
+			return nil, nil
+		}
+		return BoxEvent{EventMeta: meta, Name: data[0]}, nil
+	case "progress":
+		if len(data) < 2 {
+			return nil, nil
+		}
+		current, _ := strconv.ParseInt(data[0], 10, 64)
+		total, _ := strconv.ParseInt(data[1], 10, 64)
+		var rate string
+		if len(data) > 2 {
+			rate = data[2]
+		}
+		return ProgressEvent{EventMeta: meta, Rate: rate, Current: current, Total: total}, nil
+	case "error-exit":
+		return ErrorEvent{EventMeta: meta, Message: strings.Join(data, ": ")}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,108 @@
+package vagrantutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Event
+		wantErr bool
+	}{
+		{
+			name: "ui",
+			line: `1460000000,default,ui,info,Bringing machine 'default' up...`,
+			want: UIEvent{
+				EventMeta: EventMeta{Timestamp: "1460000000", Target: "default"},
+				Level:     "info",
+				Message:   "Bringing machine 'default' up...",
+			},
+		},
+		{
+			name: "state",
+			line: `1460000000,default,state,running`,
+			want: StateEvent{
+				EventMeta: EventMeta{Timestamp: "1460000000", Target: "default"},
+				State:     Running,
+			},
+		},
+		{
+			name: "unknown state is skipped, not an error",
+			line: `1460000000,default,state,some-future-state`,
+			want: nil,
+		},
+		{
+			name: "box-name",
+			line: `1460000000,default,box-name,ubuntu/trusty64`,
+			want: BoxEvent{
+				EventMeta: EventMeta{Timestamp: "1460000000", Target: "default"},
+				Name:      "ubuntu/trusty64",
+			},
+		},
+		{
+			name: "progress",
+			line: `1460000000,default,progress,50,100,1024/s`,
+			want: ProgressEvent{
+				EventMeta: EventMeta{Timestamp: "1460000000", Target: "default"},
+				Current:   50,
+				Total:     100,
+				Rate:      "1024/s",
+			},
+		},
+		{
+			name: "progress without rate",
+			line: `1460000000,default,progress,50,100`,
+			want: ProgressEvent{
+				EventMeta: EventMeta{Timestamp: "1460000000", Target: "default"},
+				Current:   50,
+				Total:     100,
+			},
+		},
+		{
+			name: "error-exit",
+			line: `1460000000,default,error-exit,Vagrant::Errors::VMNotFoundError,The box could not be found.`,
+			want: ErrorEvent{
+				EventMeta: EventMeta{Timestamp: "1460000000", Target: "default"},
+				Message:   "Vagrant::Errors::VMNotFoundError: The box could not be found.",
+			},
+		},
+		{
+			name: "unmodeled type is skipped",
+			line: `1460000000,default,metadata,some,data`,
+			want: nil,
+		},
+		{
+			name: "too few fields is skipped",
+			line: `1460000000,default`,
+			want: nil,
+		},
+		{
+			name:    "malformed csv",
+			line:    `1460000000,default,"unterminated`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEvent(tt.line)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseEvent() error = nil, want error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parseEvent() unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseEvent() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
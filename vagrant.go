@@ -1,16 +1,12 @@
 package vagrantutil
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"encoding/csv"
 	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
 	"os"
-	"os/exec"
 	"os/user"
 	"path/filepath"
 	"strings"
@@ -51,6 +47,28 @@ type Vagrant struct {
 	// VagrantfilePath is the directory with specifies the directory where
 	// Vagrantfile is being stored.
 	VagrantfilePath string
+
+	// Binary is the vagrant executable to run. It defaults to "vagrant"
+	// resolved from PATH; override it to point at a fake shim in tests or
+	// a non-standard install.
+	Binary string
+
+	// Provider selects the backend Vagrant uses to create the machine
+	// (e.g. "libvirt", "vmware_fusion", "hyperv"), translated to a
+	// --provider= flag on "vagrant up" invocations only; other subcommands
+	// are run without it.
+	Provider string
+
+	// DotfilePath, if set, overrides the directory Vagrant stores its
+	// per-project state in (VAGRANT_DOTFILE_PATH), letting multiple
+	// Vagrant instances run against the same Vagrantfile without sharing
+	// state.
+	DotfilePath string
+
+	// Env is merged into every invocation's environment, letting callers
+	// set arbitrary variables such as VAGRANT_CWD or variables the
+	// selected provider needs.
+	Env map[string]string
 }
 
 // NewVagrant returns a new Vagrant instance for the given name. The name
@@ -104,109 +122,463 @@ func (v *Vagrant) Box(subcommand BoxSubcommand) (string, error) {
 	return strings.TrimSpace(out), nil
 }
 
-func (v *Vagrant) Status() (Status, error) {
+// Machine represents a single guest defined in the Vagrantfile. A
+// single-machine Vagrantfile has exactly one Machine named "default"; a
+// multi-machine Vagrantfile (one using config.vm.define) has one per guest.
+type Machine struct {
+	Name     string
+	Status   Status
+	ID       string
+	Provider string
+}
+
+// Machines enumerates the guests defined in the Vagrantfile by parsing the
+// machine-readable "state", "machine-id" and "provider-name" records,
+// keyed by their target machine.
+func (v *Vagrant) Machines() ([]Machine, error) {
 	if err := v.vagrantfileExists(); err != nil {
-		return Unknown, err
+		return nil, err
 	}
 
 	out, err := v.runCommand("status")
 	if err != nil {
-		return Unknown, err
+		return nil, err
 	}
 
 	records, err := parseRecords(out)
+	if err != nil {
+		return nil, err
+	}
+
+	return machinesFromRecords(records)
+}
+
+// Status returns the status of a single machine. If no machine name is
+// given, it returns the status of the Vagrantfile's only machine; for a
+// multi-machine Vagrantfile with no name given, use Statuses instead.
+func (v *Vagrant) Status(machine ...string) (Status, error) {
+	m, err := machineArgs(machine)
 	if err != nil {
 		return Unknown, err
 	}
 
-	status, err := parseData(records, "state")
+	machines, err := v.Machines()
 	if err != nil {
 		return Unknown, err
 	}
 
-	return toStatus(status)
+	if len(m) == 1 {
+		for _, mm := range machines {
+			if mm.Name == m[0] {
+				return mm.Status, nil
+			}
+		}
+
+		return Unknown, fmt.Errorf("vagrantutil: no such machine: %s", m[0])
+	}
+
+	if len(machines) != 1 {
+		return Unknown, errors.New("vagrantutil: multiple machines defined, specify a machine name or use Statuses")
+	}
+
+	return machines[0].Status, nil
 }
 
-// Up executes "vagrant up" for the given vagrantfile. The returned channel
-// contains the output stream. At the end of the output, the error is put into
-// the Error field if there is any.
-func (v *Vagrant) Up(vagrantfile string) (<-chan *CommandOutput, error) {
+// Statuses returns the status of every machine defined in the Vagrantfile,
+// keyed by machine name.
+func (v *Vagrant) Statuses() (map[string]Status, error) {
+	machines, err := v.Machines()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make(map[string]Status, len(machines))
+	for _, m := range machines {
+		statuses[m.Name] = m.Status
+	}
+
+	return statuses, nil
+}
+
+// Up executes "vagrant up" for the given vagrantfile, optionally targeting a
+// single machine in a multi-machine environment. The returned channel
+// contains the output stream. At the end of the output, the error is put
+// into the Error field if there is any.
+func (v *Vagrant) Up(vagrantfile string, machine ...string) (<-chan *CommandOutput, error) {
+	return v.UpContext(context.Background(), vagrantfile, machine...)
+}
+
+// UpContext is like Up, but additionally accepts a context to cancel the
+// running command. When ctx is cancelled or its deadline is exceeded,
+// vagrant is sent SIGINT so provisioners get a chance to clean up, followed
+// by SIGKILL if it hasn't exited within the grace period; the channel's
+// final CommandOutput.Error is ctx.Err() in that case.
+func (v *Vagrant) UpContext(ctx context.Context, vagrantfile string, machine ...string) (<-chan *CommandOutput, error) {
 	if vagrantfile == "" {
 		return nil, errors.New("Vagrantfile content is empty")
 	}
 
-	// if it's exists, don't overwrite anything and use the existing one
+	m, err := machineArgs(machine)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := v.Create(vagrantfile); err != nil {
+		return nil, err
+	}
+
+	// --provider is only accepted by "vagrant up" itself; every other
+	// subcommand rejects it with "an invalid option was specified", so it
+	// must not be added by startCommand for those.
+	return v.startCommand(ctx, v.withProvider(append([]string{"up"}, m...))...)
+}
+
+// Destroy executes "vagrant destroy", optionally targeting a single machine
+// in a multi-machine environment. The returned channel contains the output
+// stream, mirroring Up.
+func (v *Vagrant) Destroy(machine ...string) (<-chan *CommandOutput, error) {
+	return v.DestroyContext(context.Background(), machine...)
+}
+
+// DestroyContext is like Destroy, but additionally accepts a context to
+// cancel the running command, with the same cancellation semantics as
+// UpContext.
+func (v *Vagrant) DestroyContext(ctx context.Context, machine ...string) (<-chan *CommandOutput, error) {
 	if err := v.vagrantfileExists(); err != nil {
-		err := ioutil.WriteFile(v.vagrantfile(), []byte(vagrantfile), 0644)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		// TODO(arslan): replace logging with koding/logging
-		log.Printf("Using existing Vagrantfile at %s", v.VagrantfilePath)
+		return nil, err
 	}
 
-	cmd := v.createCommand("up")
-	stdoutPipe, err := cmd.StdoutPipe()
+	m, err := machineArgs(machine)
 	if err != nil {
 		return nil, err
 	}
 
-	stderrPipe, err := cmd.StderrPipe()
+	args := append(append([]string{"destroy"}, m...), "--force")
+	return v.startCommand(ctx, args...)
+}
+
+// Halt executes "vagrant halt", optionally targeting a single machine in a
+// multi-machine environment. The returned channel contains the output
+// stream, mirroring Up.
+func (v *Vagrant) Halt(machine ...string) (<-chan *CommandOutput, error) {
+	return v.HaltContext(context.Background(), machine...)
+}
+
+// HaltContext is like Halt, but additionally accepts a context to cancel
+// the running command, with the same cancellation semantics as UpContext.
+func (v *Vagrant) HaltContext(ctx context.Context, machine ...string) (<-chan *CommandOutput, error) {
+	if err := v.vagrantfileExists(); err != nil {
+		return nil, err
+	}
+
+	m, err := machineArgs(machine)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := cmd.Start(); err != nil {
+	return v.startCommand(ctx, append([]string{"halt"}, m...)...)
+}
+
+// Suspend executes "vagrant suspend", optionally targeting a single machine
+// in a multi-machine environment. The returned channel contains the output
+// stream, mirroring Up.
+func (v *Vagrant) Suspend(machine ...string) (<-chan *CommandOutput, error) {
+	return v.SuspendContext(context.Background(), machine...)
+}
+
+// SuspendContext is like Suspend, but additionally accepts a context to
+// cancel the running command, with the same cancellation semantics as
+// UpContext.
+func (v *Vagrant) SuspendContext(ctx context.Context, machine ...string) (<-chan *CommandOutput, error) {
+	if err := v.vagrantfileExists(); err != nil {
 		return nil, err
 	}
 
-	out := make(chan *CommandOutput)
+	m, err := machineArgs(machine)
+	if err != nil {
+		return nil, err
+	}
 
-	go func() {
-		scanner := bufio.NewScanner(io.MultiReader(stderrPipe, stdoutPipe))
-		for scanner.Scan() {
-			out <- &CommandOutput{Line: scanner.Text(), Error: nil}
-		}
+	return v.startCommand(ctx, append([]string{"suspend"}, m...)...)
+}
 
-		if err := scanner.Err(); err != nil {
-			out <- &CommandOutput{Line: "", Error: err}
-		}
+// Resume executes "vagrant resume", optionally targeting a single machine in
+// a multi-machine environment. The returned channel contains the output
+// stream, mirroring Up.
+func (v *Vagrant) Resume(machine ...string) (<-chan *CommandOutput, error) {
+	return v.ResumeContext(context.Background(), machine...)
+}
 
-		if err := cmd.Wait(); err != nil {
-			out <- &CommandOutput{Line: "", Error: err}
-		}
-		close(out)
-	}()
+// ResumeContext is like Resume, but additionally accepts a context to
+// cancel the running command, with the same cancellation semantics as
+// UpContext.
+func (v *Vagrant) ResumeContext(ctx context.Context, machine ...string) (<-chan *CommandOutput, error) {
+	if err := v.vagrantfileExists(); err != nil {
+		return nil, err
+	}
+
+	m, err := machineArgs(machine)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.startCommand(ctx, append([]string{"resume"}, m...)...)
+}
 
-	return out, nil
+// Reload executes "vagrant reload", optionally targeting a single machine in
+// a multi-machine environment. The returned channel contains the output
+// stream, mirroring Up.
+func (v *Vagrant) Reload(machine ...string) (<-chan *CommandOutput, error) {
+	return v.ReloadContext(context.Background(), machine...)
 }
 
-// Destroy executes "vagrant destroy". The returned reader contains the output
-// stream. The client is responsible of calling the Close method of the
-// returned reader.
-func (v *Vagrant) Destroy() (io.ReadCloser, error) {
+// ReloadContext is like Reload, but additionally accepts a context to
+// cancel the running command, with the same cancellation semantics as
+// UpContext.
+func (v *Vagrant) ReloadContext(ctx context.Context, machine ...string) (<-chan *CommandOutput, error) {
 	if err := v.vagrantfileExists(); err != nil {
 		return nil, err
 	}
 
-	cmd := v.createCommand("destroy", "--force")
-	pipe, err := cmd.StdoutPipe()
+	m, err := machineArgs(machine)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := cmd.Start(); err != nil {
+	return v.startCommand(ctx, append([]string{"reload"}, m...)...)
+}
+
+// Provision executes "vagrant provision", optionally targeting a single
+// machine in a multi-machine environment. The returned channel contains the
+// output stream, mirroring Up.
+func (v *Vagrant) Provision(machine ...string) (<-chan *CommandOutput, error) {
+	return v.ProvisionContext(context.Background(), machine...)
+}
+
+// ProvisionContext is like Provision, but additionally accepts a context to
+// cancel the running command, with the same cancellation semantics as
+// UpContext.
+func (v *Vagrant) ProvisionContext(ctx context.Context, machine ...string) (<-chan *CommandOutput, error) {
+	if err := v.vagrantfileExists(); err != nil {
 		return nil, err
 	}
 
-	go func() {
-		if err := cmd.Wait(); err != nil {
-			log.Printf("[error]: vagrant up error: %s", err)
-		}
-	}()
+	m, err := machineArgs(machine)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.startCommand(ctx, append([]string{"provision"}, m...)...)
+}
+
+// PackageOptions configures the "vagrant package" command.
+type PackageOptions struct {
+	// Output is the name of the resulting box file. If empty, Vagrant's
+	// own default ("package.box") is used.
+	Output string
+
+	// Include lists additional files to bundle into the box.
+	Include []string
+
+	// Vagrantfile is an optional Vagrantfile to embed in the resulting box.
+	Vagrantfile string
+}
+
+func (opts *PackageOptions) args() []string {
+	if opts == nil {
+		return nil
+	}
+
+	var args []string
+	if opts.Output != "" {
+		args = append(args, "--output", opts.Output)
+	}
+	if len(opts.Include) > 0 {
+		args = append(args, "--include", strings.Join(opts.Include, ","))
+	}
+	if opts.Vagrantfile != "" {
+		args = append(args, "--vagrantfile", opts.Vagrantfile)
+	}
+
+	return args
+}
+
+// Package executes "vagrant package", optionally targeting a single machine
+// in a multi-machine environment. The returned channel contains the output
+// stream, mirroring Up.
+func (v *Vagrant) Package(opts *PackageOptions, machine ...string) (<-chan *CommandOutput, error) {
+	return v.PackageContext(context.Background(), opts, machine...)
+}
+
+// PackageContext is like Package, but additionally accepts a context to
+// cancel the running command, with the same cancellation semantics as
+// UpContext.
+func (v *Vagrant) PackageContext(ctx context.Context, opts *PackageOptions, machine ...string) (<-chan *CommandOutput, error) {
+	if err := v.vagrantfileExists(); err != nil {
+		return nil, err
+	}
+
+	m, err := machineArgs(machine)
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]string{"package"}, m...)
+	return v.startCommand(ctx, append(args, opts.args()...)...)
+}
+
+// SnapshotSave executes "vagrant snapshot save" with the given snapshot
+// name, optionally targeting a single machine in a multi-machine
+// environment. The returned channel contains the output stream, mirroring
+// Up.
+func (v *Vagrant) SnapshotSave(name string, machine ...string) (<-chan *CommandOutput, error) {
+	return v.SnapshotSaveContext(context.Background(), name, machine...)
+}
+
+// SnapshotSaveContext is like SnapshotSave, but additionally accepts a
+// context to cancel the running command, with the same cancellation
+// semantics as UpContext.
+func (v *Vagrant) SnapshotSaveContext(ctx context.Context, name string, machine ...string) (<-chan *CommandOutput, error) {
+	if err := v.vagrantfileExists(); err != nil {
+		return nil, err
+	}
+
+	m, err := machineArgs(machine)
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]string{"snapshot", "save"}, m...)
+	return v.startCommand(ctx, append(args, name)...)
+}
+
+// SnapshotRestore executes "vagrant snapshot restore" with the given
+// snapshot name, optionally targeting a single machine in a multi-machine
+// environment. The returned channel contains the output stream, mirroring
+// Up.
+func (v *Vagrant) SnapshotRestore(name string, machine ...string) (<-chan *CommandOutput, error) {
+	return v.SnapshotRestoreContext(context.Background(), name, machine...)
+}
+
+// SnapshotRestoreContext is like SnapshotRestore, but additionally accepts
+// a context to cancel the running command, with the same cancellation
+// semantics as UpContext.
+func (v *Vagrant) SnapshotRestoreContext(ctx context.Context, name string, machine ...string) (<-chan *CommandOutput, error) {
+	if err := v.vagrantfileExists(); err != nil {
+		return nil, err
+	}
+
+	m, err := machineArgs(machine)
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]string{"snapshot", "restore"}, m...)
+	return v.startCommand(ctx, append(args, name)...)
+}
+
+// SnapshotDelete executes "vagrant snapshot delete" with the given snapshot
+// name, optionally targeting a single machine in a multi-machine
+// environment. The returned channel contains the output stream, mirroring
+// Up.
+func (v *Vagrant) SnapshotDelete(name string, machine ...string) (<-chan *CommandOutput, error) {
+	return v.SnapshotDeleteContext(context.Background(), name, machine...)
+}
+
+// SnapshotDeleteContext is like SnapshotDelete, but additionally accepts a
+// context to cancel the running command, with the same cancellation
+// semantics as UpContext.
+func (v *Vagrant) SnapshotDeleteContext(ctx context.Context, name string, machine ...string) (<-chan *CommandOutput, error) {
+	if err := v.vagrantfileExists(); err != nil {
+		return nil, err
+	}
+
+	m, err := machineArgs(machine)
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]string{"snapshot", "delete"}, m...)
+	return v.startCommand(ctx, append(args, name)...)
+}
+
+// SnapshotList executes "vagrant snapshot list", optionally targeting a
+// single machine in a multi-machine environment. The returned channel
+// contains the output stream, mirroring Up.
+func (v *Vagrant) SnapshotList(machine ...string) (<-chan *CommandOutput, error) {
+	return v.SnapshotListContext(context.Background(), machine...)
+}
+
+// SnapshotListContext is like SnapshotList, but additionally accepts a
+// context to cancel the running command, with the same cancellation
+// semantics as UpContext.
+func (v *Vagrant) SnapshotListContext(ctx context.Context, machine ...string) (<-chan *CommandOutput, error) {
+	if err := v.vagrantfileExists(); err != nil {
+		return nil, err
+	}
 
-	return pipe, nil
+	m, err := machineArgs(machine)
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]string{"snapshot", "list"}, m...)
+	return v.startCommand(ctx, args...)
+}
+
+// machineArgs validates the optional machine name passed to a variadic
+// "machine ...string" parameter and returns it as a CLI argument slice
+// ready to be appended after the vagrant subcommand. At most one machine
+// name may be given.
+func machineArgs(machine []string) ([]string, error) {
+	switch len(machine) {
+	case 0:
+		return nil, nil
+	case 1:
+		return machine, nil
+	default:
+		return nil, errors.New("vagrantutil: at most one machine name may be given")
+	}
+}
+
+// startCommand executes the given vagrant subcommand and its arguments,
+// streaming the combined stdout/stderr output on the returned channel. At
+// the end of the output, the error is put into the Error field if there is
+// any. See command.start for ctx's cancellation semantics.
+func (v *Vagrant) startCommand(ctx context.Context, args ...string) (<-chan *CommandOutput, error) {
+	return v.newCommand().start(ctx, args...)
+}
+
+// newCommand builds a command configured with this Vagrant's Binary and
+// environment overrides.
+func (v *Vagrant) newCommand() *command {
+	cmd := newCommand(v.VagrantfilePath, nil)
+	cmd.binary = v.Binary
+	cmd.env = v.envVars()
+	return cmd
+}
+
+// withProvider appends a --provider= flag for v.Provider, if set. Only
+// "vagrant up" accepts this flag, so callers must apply it to the "up"
+// args themselves rather than relying on startCommand to add it.
+func (v *Vagrant) withProvider(args []string) []string {
+	if v.Provider == "" {
+		return args
+	}
+	return append(args, "--provider="+v.Provider)
+}
+
+// envVars returns the environment overrides to merge into every
+// invocation: DotfilePath as VAGRANT_DOTFILE_PATH plus anything in Env.
+func (v *Vagrant) envVars() map[string]string {
+	env := make(map[string]string, len(v.Env)+1)
+	for k, val := range v.Env {
+		env[k] = val
+	}
+	if v.DotfilePath != "" {
+		env["VAGRANT_DOTFILE_PATH"] = v.DotfilePath
+	}
+	return env
 }
 
 // vagrantfile returns the Vagrantfile path
@@ -223,22 +595,9 @@ func (v *Vagrant) vagrantfileExists() error {
 	return nil
 }
 
-func (v *Vagrant) createCommand(args ...string) *exec.Cmd {
-	cmd := exec.Command("vagrant", args...)
-	cmd.Dir = v.VagrantfilePath
-	return cmd
-}
-
 func (v *Vagrant) runCommand(args ...string) (string, error) {
 	args = append(args, "--machine-readable")
-	cmd := exec.Command("vagrant", args...)
-	cmd.Dir = v.VagrantfilePath
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", err
-	}
-
-	return string(out), nil
+	return v.newCommand().run(context.Background(), args...)
 }
 
 func parseData(records [][]string, typeName string) (string, error) {
@@ -269,6 +628,57 @@ func parseRecords(out string) ([][]string, error) {
 	return c.ReadAll()
 }
 
+// machinesFromRecords builds the list of Machine values out of
+// machine-readable records, keying each record by its target machine
+// column rather than assuming a single row. Machines are returned in the
+// order they're first seen in the records.
+func machinesFromRecords(records [][]string) ([]Machine, error) {
+	var order []string
+	byName := make(map[string]*Machine)
+
+	for _, record := range records {
+		if len(record) < 4 {
+			continue
+		}
+
+		name, typeName, data := record[1], record[2], record[3]
+		if name == "" {
+			continue
+		}
+
+		m, ok := byName[name]
+		if !ok {
+			m = &Machine{Name: name}
+			byName[name] = m
+			order = append(order, name)
+		}
+
+		switch typeName {
+		case "state":
+			status, err := toStatus(data)
+			if err != nil {
+				return nil, err
+			}
+			m.Status = status
+		case "machine-id":
+			m.ID = data
+		case "provider-name":
+			m.Provider = data
+		}
+	}
+
+	if len(order) == 0 {
+		return nil, errors.New("vagrantutil: no machines found")
+	}
+
+	machines := make([]Machine, len(order))
+	for i, name := range order {
+		machines[i] = *byName[name]
+	}
+
+	return machines, nil
+}
+
 // toStatus convers the given state string to Status type
 func toStatus(state string) (Status, error) {
 	switch state {
@@ -0,0 +1,279 @@
+package vagrantutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// SyncedFolder maps a host path to a path inside the guest via
+// config.vm.synced_folder.
+type SyncedFolder struct {
+	Source string
+	Target string
+}
+
+// PortForward forwards a guest port to a host port via
+// config.vm.network "forwarded_port".
+type PortForward struct {
+	Guest int
+	Host  int
+}
+
+// ProvisionerType identifies the kind of Vagrant provisioner a Provisioner
+// configures.
+type ProvisionerType int
+
+const (
+	ShellProvisioner ProvisionerType = iota
+	FileProvisioner
+	AnsibleProvisioner
+)
+
+// Provisioner configures a single config.vm.provision block. Which fields
+// apply depends on Type: ShellProvisioner uses Inline or Path,
+// FileProvisioner uses Source and Destination, AnsibleProvisioner uses
+// Playbook.
+type Provisioner struct {
+	Type ProvisionerType
+
+	// Inline is an inline shell script. Mutually exclusive with Path.
+	Inline string
+
+	// Path is a path to a shell script on the host. Mutually exclusive
+	// with Inline.
+	Path string
+
+	// Source and Destination are the host and guest paths for a file
+	// provisioner.
+	Source      string
+	Destination string
+
+	// Playbook is the path to an Ansible playbook on the host.
+	Playbook string
+}
+
+// MachineConfig configures a single named guest in a multi-machine
+// Vagrantfile via config.vm.define. If Vagrantfile is set, its Box is
+// required; any other fields left zero are not emitted for that guest.
+type MachineConfig struct {
+	Name string
+	*Vagrantfile
+}
+
+// Vagrantfile is a typed, programmatic description of a Vagrantfile. Render
+// turns it into valid Ruby that can be passed to Create or Up.
+type Vagrantfile struct {
+	Box      string
+	Hostname string
+	Memory   int
+	CPUs     int
+	Provider string
+
+	SyncedFolders  []SyncedFolder
+	ForwardedPorts []PortForward
+	PrivateNetwork string
+
+	Provisioners []Provisioner
+
+	// Defines configures additional named guests for a multi-machine
+	// Vagrantfile. The fields above describe the primary machine.
+	Defines []MachineConfig
+}
+
+// Render validates vf and renders it as valid Ruby, ready to be written to
+// disk via Create or passed directly to Up.
+func (vf *Vagrantfile) Render() (string, error) {
+	if err := vf.validate(); err != nil {
+		return "", err
+	}
+
+	var body bytes.Buffer
+	if err := compiledVagrantfileTemplate().Execute(&body, renderView(vf, "config")); err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	out.WriteString("# -*- mode: ruby -*-\n# vi: set ft=ruby :\n\n")
+	out.WriteString(`Vagrant.configure("2") do |config|` + "\n")
+	indent(&out, body.String())
+	out.WriteString("end\n")
+
+	return out.String(), nil
+}
+
+// indent writes body to dst, indenting every non-blank line by two spaces
+// to match the rest of the do...end block.
+func indent(dst *bytes.Buffer, body string) {
+	for _, line := range strings.Split(strings.TrimRight(body, "\n"), "\n") {
+		if line == "" {
+			dst.WriteString("\n")
+			continue
+		}
+		dst.WriteString("  ")
+		dst.WriteString(line)
+		dst.WriteString("\n")
+	}
+}
+
+func (vf *Vagrantfile) validate() error {
+	if vf.Box == "" {
+		return errors.New("vagrantutil: Vagrantfile.Box is required")
+	}
+	if vf.Memory < 0 {
+		return errors.New("vagrantutil: Vagrantfile.Memory must not be negative")
+	}
+	if vf.CPUs < 0 {
+		return errors.New("vagrantutil: Vagrantfile.CPUs must not be negative")
+	}
+
+	for _, p := range vf.ForwardedPorts {
+		if p.Guest <= 0 || p.Guest > 65535 {
+			return fmt.Errorf("vagrantutil: invalid forwarded guest port: %d", p.Guest)
+		}
+		if p.Host <= 0 || p.Host > 65535 {
+			return fmt.Errorf("vagrantutil: invalid forwarded host port: %d", p.Host)
+		}
+	}
+
+	for _, d := range vf.Defines {
+		if d.Name == "" {
+			return errors.New("vagrantutil: MachineConfig.Name is required")
+		}
+		if d.Vagrantfile != nil {
+			if err := d.Vagrantfile.validate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// view adapts a Vagrantfile to the template, adding the few computed
+// values (the block's receiver variable name and the resolved provider)
+// the template needs but that aren't plain struct fields.
+type view struct {
+	*Vagrantfile
+	Receiver string
+}
+
+func renderView(vf *Vagrantfile, receiver string) view {
+	return view{Vagrantfile: vf, Receiver: receiver}
+}
+
+func (vw view) ProviderName() string {
+	if vw.Provider != "" {
+		return vw.Provider
+	}
+	return "virtualbox"
+}
+
+func (vw view) NeedsProvider() bool {
+	return vw.Memory > 0 || vw.CPUs > 0 || vw.Provider != ""
+}
+
+func provisionerRuby(p Provisioner) (string, error) {
+	switch p.Type {
+	case ShellProvisioner:
+		switch {
+		case p.Inline != "":
+			return fmt.Sprintf("%q, inline: %q", "shell", p.Inline), nil
+		case p.Path != "":
+			return fmt.Sprintf("%q, path: %q", "shell", p.Path), nil
+		}
+		return "", errors.New("vagrantutil: shell Provisioner needs Inline or Path")
+	case FileProvisioner:
+		if p.Source == "" || p.Destination == "" {
+			return "", errors.New("vagrantutil: file Provisioner needs Source and Destination")
+		}
+		return fmt.Sprintf("%q, source: %q, destination: %q", "file", p.Source, p.Destination), nil
+	case AnsibleProvisioner:
+		if p.Playbook == "" {
+			return "", errors.New("vagrantutil: ansible Provisioner needs Playbook")
+		}
+		return fmt.Sprintf("%q, playbook: %q", "ansible", p.Playbook), nil
+	default:
+		return "", fmt.Errorf("vagrantutil: unknown ProvisionerType: %d", p.Type)
+	}
+}
+
+func renderDefine(m MachineConfig) (string, error) {
+	if m.Vagrantfile == nil {
+		return "", nil
+	}
+
+	var body bytes.Buffer
+	if err := compiledVagrantfileTemplate().Execute(&body, renderView(m.Vagrantfile, "node")); err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	indent(&out, body.String())
+
+	return out.String(), nil
+}
+
+// compiledVagrantfileTemplate lazily parses vagrantfileTemplate on first use.
+// It can't be a plain package-level var: its "machine" func is renderDefine,
+// which itself executes this same template, and a var initializer that
+// refers back to itself (even indirectly, through a function it merely
+// names) is an initialization cycle the compiler rejects.
+var (
+	vagrantfileTemplateOnce sync.Once
+	vagrantfileTemplate     *template.Template
+)
+
+func compiledVagrantfileTemplate() *template.Template {
+	vagrantfileTemplateOnce.Do(func() {
+		vagrantfileTemplate = template.Must(template.New("Vagrantfile").Funcs(template.FuncMap{
+			"provision": provisionerRuby,
+			"machine":   renderDefine,
+		}).Parse(`{{.Receiver}}.vm.box = {{printf "%q" .Box}}
+{{if .Hostname}}{{.Receiver}}.vm.hostname = {{printf "%q" .Hostname}}
+{{end}}{{if .PrivateNetwork}}{{.Receiver}}.vm.network "private_network", ip: {{printf "%q" .PrivateNetwork}}
+{{end}}{{range .ForwardedPorts}}{{$.Receiver}}.vm.network "forwarded_port", guest: {{.Guest}}, host: {{.Host}}
+{{end}}{{range .SyncedFolders}}{{$.Receiver}}.vm.synced_folder {{printf "%q" .Source}}, {{printf "%q" .Target}}
+{{end}}{{if .NeedsProvider}}{{.Receiver}}.vm.provider {{printf "%q" .ProviderName}} do |vb|
+{{if .Memory}}  vb.memory = {{.Memory}}
+{{end}}{{if .CPUs}}  vb.cpus = {{.CPUs}}
+{{end}}end
+{{end}}{{range .Provisioners}}{{$.Receiver}}.vm.provision {{provision .}}
+{{end}}{{range .Defines}}
+{{$.Receiver}}.vm.define {{printf "%q" .Name}} do |node|
+{{machine .}}end
+{{end}}`))
+	})
+
+	return vagrantfileTemplate
+}
+
+// Create writes vagrantfile to disk without starting the environment. If a
+// Vagrantfile already exists it is left untouched, mirroring Up.
+func (v *Vagrant) Create(vagrantfile string) error {
+	if vagrantfile == "" {
+		return errors.New("Vagrantfile content is empty")
+	}
+
+	if err := v.vagrantfileExists(); err != nil {
+		return ioutil.WriteFile(v.vagrantfile(), []byte(vagrantfile), 0644)
+	}
+
+	log.Printf("Using existing Vagrantfile at %s", v.VagrantfilePath)
+	return nil
+}
+
+// CreateVagrantfile renders vf and writes it to disk via Create.
+func (v *Vagrant) CreateVagrantfile(vf *Vagrantfile) error {
+	content, err := vf.Render()
+	if err != nil {
+		return err
+	}
+
+	return v.Create(content)
+}
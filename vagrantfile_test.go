@@ -0,0 +1,136 @@
+package vagrantutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVagrantfileRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		vf      *Vagrantfile
+		wantErr bool
+		want    []string // substrings that must appear in the rendered output
+	}{
+		{
+			name:    "box required",
+			vf:      &Vagrantfile{},
+			wantErr: true,
+		},
+		{
+			name: "minimal",
+			vf:   &Vagrantfile{Box: "ubuntu/trusty64"},
+			want: []string{
+				`Vagrant.configure("2") do |config|`,
+				`config.vm.box = "ubuntu/trusty64"`,
+			},
+		},
+		{
+			name: "hostname and private network",
+			vf: &Vagrantfile{
+				Box:            "ubuntu/trusty64",
+				Hostname:       "vagrant",
+				PrivateNetwork: "192.168.33.10",
+			},
+			want: []string{
+				`config.vm.hostname = "vagrant"`,
+				`config.vm.network "private_network", ip: "192.168.33.10"`,
+			},
+		},
+		{
+			name: "synced folders and forwarded ports",
+			vf: &Vagrantfile{
+				Box:            "ubuntu/trusty64",
+				SyncedFolders:  []SyncedFolder{{Source: "./src", Target: "/src"}},
+				ForwardedPorts: []PortForward{{Guest: 80, Host: 8080}},
+			},
+			want: []string{
+				`config.vm.synced_folder "./src", "/src"`,
+				`config.vm.network "forwarded_port", guest: 80, host: 8080`,
+			},
+		},
+		{
+			name: "invalid forwarded port",
+			vf: &Vagrantfile{
+				Box:            "ubuntu/trusty64",
+				ForwardedPorts: []PortForward{{Guest: 0, Host: 8080}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "provider and resources",
+			vf: &Vagrantfile{
+				Box:      "ubuntu/trusty64",
+				Provider: "libvirt",
+				Memory:   2048,
+				CPUs:     2,
+			},
+			want: []string{
+				`config.vm.provider "libvirt" do |vb|`,
+				`vb.memory = 2048`,
+				`vb.cpus = 2`,
+			},
+		},
+		{
+			name: "shell provisioner",
+			vf: &Vagrantfile{
+				Box:          "ubuntu/trusty64",
+				Provisioners: []Provisioner{{Type: ShellProvisioner, Inline: "echo hi"}},
+			},
+			want: []string{
+				`config.vm.provision "shell", inline: "echo hi"`,
+			},
+		},
+		{
+			name: "shell provisioner missing content",
+			vf: &Vagrantfile{
+				Box:          "ubuntu/trusty64",
+				Provisioners: []Provisioner{{Type: ShellProvisioner}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "multi-machine define",
+			vf: &Vagrantfile{
+				Box: "ubuntu/trusty64",
+				Defines: []MachineConfig{
+					{Name: "web", Vagrantfile: &Vagrantfile{Box: "ubuntu/trusty64", Hostname: "web"}},
+				},
+			},
+			want: []string{
+				`config.vm.define "web" do |node|`,
+				`node.vm.hostname = "web"`,
+			},
+		},
+		{
+			name: "define missing name",
+			vf: &Vagrantfile{
+				Box:     "ubuntu/trusty64",
+				Defines: []MachineConfig{{Vagrantfile: &Vagrantfile{Box: "ubuntu/trusty64"}}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tt.vf.Render()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Render() error = nil, want error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Render() unexpected error: %s", err)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("Render() output missing %q, got:\n%s", want, out)
+				}
+			}
+		})
+	}
+}